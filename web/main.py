@@ -1,13 +1,15 @@
 #!/usr/bin/env python3
 # main.py
-from fastapi import FastAPI, HTTPException
+from fastapi import FastAPI, HTTPException, Request
 from fastapi.staticfiles import StaticFiles
-from fastapi.responses import RedirectResponse
+from fastapi.responses import RedirectResponse, JSONResponse
+from starlette.routing import Match
 from Communication import read_var, write_var
+import config
 from datetime import datetime, timedelta
 from pydantic import BaseModel, Field
 from pathlib import Path
-from typing import List, Dict
+from typing import List, Dict, Optional
 from enum import Enum
 import json
 import threading
@@ -181,6 +183,193 @@ threading.Thread(target=collector, daemon=True).start()
 def get_history():
     return list(history)
 
+# ---------- 维护窗口：提前倒计时，窗口期内禁止写入 ----------
+class MaintenanceWindow(BaseModel):
+    start: datetime
+    end: datetime
+    reason: str = ""
+
+MUTATING_METHODS = {"POST", "PUT", "PATCH", "DELETE"}
+# 维护窗口与只读模式的控制接口，两个拦截器都放行，保证随时能开关
+CONTROL_PATHS = ("/api/maintenance", "/api/read-only")
+maintenance: Optional[MaintenanceWindow] = None
+
+def _local(dt: datetime) -> datetime:
+    """统一为本地无时区时间，便于与 datetime.now() 比较"""
+    return dt.astimezone().replace(tzinfo=None) if dt.tzinfo else dt
+
+def _window_json(window: MaintenanceWindow) -> dict:
+    """对外输出带时区偏移的时间，浏览器与服务器时区不同时也能正确解析"""
+    return {
+        "start": window.start.astimezone().isoformat(timespec="seconds"),
+        "end": window.end.astimezone().isoformat(timespec="seconds"),
+        "reason": window.reason,
+    }
+
+def _current_maintenance() -> Optional[MaintenanceWindow]:
+    """返回计划中或进行中的维护窗口，已结束的自动清除"""
+    global maintenance
+    if maintenance and maintenance.end <= datetime.now():
+        maintenance = None
+    return maintenance
+
+@app.middleware("http")
+async def maintenance_guard(request: Request, call_next):
+    window = _current_maintenance()
+    if (window and window.start <= datetime.now()
+            and request.method in MUTATING_METHODS
+            and not request.url.path.startswith(CONTROL_PATHS)):
+        remaining = int((window.end - datetime.now()).total_seconds()) + 1
+        return JSONResponse(
+            status_code=503,
+            content={
+                "detail": "系统维护中，暂停写入",
+                "maintenance": _window_json(window),
+            },
+            headers={"Retry-After": str(remaining)},
+        )
+
+    response = await call_next(request)
+    if window:
+        # 前端据此显示倒计时横幅
+        info = _window_json(window)
+        response.headers["X-Maintenance-Start"] = info["start"]
+        response.headers["X-Maintenance-End"] = info["end"]
+    return response
+
+@app.get("/api/maintenance")
+def get_maintenance():
+    window = _current_maintenance()
+    if window is None:
+        return {"planned": False}
+    return {
+        "planned": True,
+        "active": window.start <= datetime.now(),
+        **_window_json(window),
+    }
+
+@app.post("/api/maintenance")
+def plan_maintenance(window: MaintenanceWindow):
+    global maintenance
+    window.start, window.end = _local(window.start), _local(window.end)
+    if window.end <= window.start:
+        raise HTTPException(status_code=400, detail="结束时间必须晚于开始时间")
+    if window.end <= datetime.now():
+        raise HTTPException(status_code=400, detail="维护窗口已过期")
+    maintenance = window
+    return get_maintenance()
+
+@app.delete("/api/maintenance")
+def cancel_maintenance():
+    global maintenance
+    maintenance = None
+    return {"ok": True}
+
+# ---------- 全局只读模式：拒绝所有写操作，监控与查询照常 ----------
+read_only: bool = bool(config.ConfigManager().get("read_only", False))
+
+@app.middleware("http")
+async def read_only_guard(request: Request, call_next):
+    if (read_only and request.method in MUTATING_METHODS
+            and not request.url.path.startswith(CONTROL_PATHS)):
+        return JSONResponse(
+            status_code=423,
+            content={"detail": "系统处于只读模式，暂停写入", "read_only": True},
+            headers={"X-Read-Only": "1"},
+        )
+
+    response = await call_next(request)
+    if read_only:
+        response.headers["X-Read-Only"] = "1"
+    return response
+
+@app.get("/api/read-only")
+def get_read_only():
+    return {"read_only": read_only}
+
+@app.post("/api/read-only")
+def set_read_only(enabled: bool):
+    """切换只读模式（仅内存生效，重启后以 config.json 的 read_only 为准）"""
+    global read_only
+    read_only = enabled
+    return {"read_only": read_only}
+
+# ---------- 接口调用统计（按日/客户端/接口汇总）----------
+# 注意：record_usage 必须最后注册，作为最外层中间件，才能统计到被维护窗口/只读模式拦截的请求
+ANALYTICS_DAYS = 7
+# {日期: {(客户端, 方法, 路由): {"count", "errors", "total_ms", "max_ms"}}}
+analytics: Dict[str, Dict[tuple, dict]] = {}
+
+def _route_path(request: Request) -> Optional[str]:
+    """返回请求对应的路由模板；被拦截器提前返回的请求未经过路由，需自行匹配"""
+    route = request.scope.get("route")
+    if route is not None:
+        return getattr(route, "path", None)
+    partial = None
+    for r in app.router.routes:
+        match, _ = r.matches(request.scope)
+        if match == Match.FULL:
+            return getattr(r, "path", None)
+        if match == Match.PARTIAL and partial is None:
+            partial = getattr(r, "path", None)
+    return partial
+
+@app.middleware("http")
+async def record_usage(request: Request, call_next):
+    start = time.perf_counter()
+    status = 500
+    try:
+        response = await call_next(request)
+        status = response.status_code
+        return response
+    finally:
+        elapsed = (time.perf_counter() - start) * 1000
+        path = _route_path(request)
+        if path is None or path == "/static":
+            # 静态文件按实际文件统计；未匹配的请求统一归类，防止扫描器刷出无数条记录
+            if request.url.path.startswith("/static/") and status < 400:
+                path = request.url.path
+            else:
+                path = "<unmatched>"
+        client = request.client.host if request.client else "unknown"
+        day = datetime.now().strftime("%Y-%m-%d")
+
+        if day not in analytics:
+            analytics[day] = {}
+            # 只保留最近 ANALYTICS_DAYS 天
+            for old in sorted(analytics)[:-ANALYTICS_DAYS]:
+                del analytics[old]
+
+        stat = analytics[day].setdefault(
+            (client, request.method, path),
+            {"count": 0, "errors": 0, "total_ms": 0.0, "max_ms": 0.0},
+        )
+        stat["count"] += 1
+        if status >= 400:
+            stat["errors"] += 1
+        stat["total_ms"] += elapsed
+        stat["max_ms"] = max(stat["max_ms"], elapsed)
+
+@app.get("/api/analytics")
+async def get_analytics(day: str = ""):
+    """按调用次数降序返回某天（默认今天）的接口调用统计"""
+    # async：与 record_usage 同在事件循环中执行，遍历时字典不会被并发修改
+    day = day or datetime.now().strftime("%Y-%m-%d")
+    rows = [
+        {
+            "client": client,
+            "method": method,
+            "path": path,
+            "count": s["count"],
+            "error_rate": round(s["errors"] / s["count"], 4),
+            "avg_ms": round(s["total_ms"] / s["count"], 2),
+            "max_ms": round(s["max_ms"], 2),
+        }
+        for (client, method, path), s in analytics.get(day, {}).items()
+    ]
+    rows.sort(key=lambda r: r["count"], reverse=True)
+    return {"day": day, "days": sorted(analytics), "rows": rows}
+
 # ---------- 静态文件 & 首页 ----------
 @app.get("/")
 def root():